@@ -0,0 +1,197 @@
+// Package common holds the pieces of strace rendering that are shared
+// across every OS's kernel package: each OS registers a syscall table built
+// from these types, and models.OS delegates its SyscallName/Strace methods
+// here instead of every OS reimplementing the same formatting.
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MemIO is the read/write interface Strace dereferences pointer arguments
+// through. It's the same shape as models.MemIO, declared separately here
+// (rather than imported) since models.OS.Strace delegates into this
+// package and an import the other way would cycle.
+type MemIO interface {
+	Read(addr uint64, p []byte) error
+	Write(addr uint64, p []byte) error
+}
+
+// ArgKind describes how a syscall argument should be rendered by Strace.
+type ArgKind int
+
+const (
+	// ArgInt renders the argument as a hex integer.
+	ArgInt ArgKind = iota
+	// ArgStr renders the argument as a NUL-terminated string, read from
+	// the MemIO passed to Strace.
+	ArgStr
+	// ArgBuf renders the argument as a byte buffer pointer; the buffer's
+	// length is read from the arg at ArgSpec.LenArg.
+	ArgBuf
+	// ArgSockaddr renders the argument as a struct sockaddr (AF_INET only,
+	// falling back to a bare family tag for anything else); the buffer's
+	// length is read from the arg at ArgSpec.LenArg.
+	ArgSockaddr
+	// ArgIOVec renders the argument as a struct iovec* / int count pair,
+	// e.g. readv/writev; the count is read from the arg at ArgSpec.LenArg.
+	ArgIOVec
+)
+
+// ArgSpec describes one syscall argument for Strace.
+type ArgSpec struct {
+	Kind ArgKind
+	// LenArg is the index into the syscall's args of the argument holding
+	// this one's length/count. Only meaningful for ArgBuf/ArgSockaddr/ArgIOVec.
+	LenArg int
+}
+
+// Syscall describes one syscall number for SyscallName/Strace lookups.
+type Syscall struct {
+	Name string
+	Args []ArgSpec
+}
+
+// Table maps a syscall number to its Syscall definition; each OS kernel
+// package builds one of these for its platform's syscall ABI.
+type Table map[int]Syscall
+
+// SyscallName resolves num to its name in table, or "" if num is unknown.
+func SyscallName(table Table, num int) string {
+	return table[num].Name
+}
+
+// maxPreview bounds how many bytes of a buffer/sockaddr Strace will read
+// and print, the same way real strace(1) truncates long arguments.
+const maxPreview = 32
+
+// maxIOVecEntries bounds how many struct iovec entries Strace will read, so
+// a corrupt/huge count argument can't turn a trace print into a giant read.
+const maxIOVecEntries = 16
+
+// maxCString bounds how far readCString will scan for a terminator, so a
+// corrupt or unmapped pointer can't turn a trace print into an infinite read.
+const maxCString = 4096
+
+// Strace renders a syscall call the way strace(1) would: string/buffer/
+// sockaddr/iovec arguments are dereferenced from mem, everything else is
+// shown as hex. Unknown syscalls fall back to "syscall_N(...)" instead of
+// an empty string so callers always get a usable line.
+func Strace(table Table, num int, args []uint64, ret uint64, mem MemIO) string {
+	sys, ok := table[num]
+	if !ok {
+		return fmt.Sprintf("syscall_%d(%s) = %d", num, joinHex(args), int64(ret))
+	}
+	strs := make([]string, len(args))
+	for i, v := range args {
+		if i >= len(sys.Args) {
+			strs[i] = fmt.Sprintf("%#x", v)
+			continue
+		}
+		spec := sys.Args[i]
+		var length uint64
+		if spec.LenArg < len(args) {
+			length = args[spec.LenArg]
+		}
+		switch spec.Kind {
+		case ArgStr:
+			strs[i] = fmt.Sprintf("%q", readCString(mem, v))
+		case ArgBuf:
+			strs[i] = renderBuf(mem, v, length)
+		case ArgSockaddr:
+			strs[i] = renderSockaddr(mem, v, length)
+		case ArgIOVec:
+			strs[i] = renderIOVec(mem, v, length)
+		default:
+			strs[i] = fmt.Sprintf("%#x", v)
+		}
+	}
+	return fmt.Sprintf("%s(%s) = %d", sys.Name, strings.Join(strs, ", "), int64(ret))
+}
+
+func readCString(mem MemIO, addr uint64) string {
+	var b strings.Builder
+	var c [1]byte
+	for i := 0; i < maxCString; i++ {
+		if err := mem.Read(addr+uint64(i), c[:]); err != nil || c[0] == 0 {
+			break
+		}
+		b.WriteByte(c[0])
+	}
+	return b.String()
+}
+
+// renderBuf previews up to maxPreview bytes of a raw buffer argument,
+// marking it truncated if the real length was longer.
+func renderBuf(mem MemIO, addr, length uint64) string {
+	n := length
+	truncated := false
+	if n > maxPreview {
+		n, truncated = maxPreview, true
+	}
+	buf := make([]byte, n)
+	if mem.Read(addr, buf) != nil {
+		return fmt.Sprintf("%#x", addr)
+	}
+	s := fmt.Sprintf("%q", string(buf))
+	if truncated {
+		s += "..."
+	}
+	return s
+}
+
+const afInet = 2
+
+// renderSockaddr parses a struct sockaddr_in (the common case); any other
+// address family is shown as a bare family tag rather than guessed at.
+func renderSockaddr(mem MemIO, addr, length uint64) string {
+	if length < 8 || length > maxPreview {
+		length = 8
+	}
+	buf := make([]byte, length)
+	if mem.Read(addr, buf) != nil || len(buf) < 8 {
+		return fmt.Sprintf("%#x", addr)
+	}
+	family := binary.LittleEndian.Uint16(buf[0:2])
+	if family != afInet {
+		return fmt.Sprintf("{sa_family=%d, ...}", family)
+	}
+	port := binary.BigEndian.Uint16(buf[2:4])
+	ip := net.IP(buf[4:8])
+	return fmt.Sprintf("{sa_family=AF_INET, sin_port=htons(%d), sin_addr=%s}", port, ip)
+}
+
+// iovecEntrySize is sizeof(struct iovec) = {void *iov_base; size_t iov_len;}
+// on a 64-bit ABI; 32-bit targets aren't handled here.
+const iovecEntrySize = 16
+
+// renderIOVec dereferences up to count struct iovec entries starting at
+// addr, showing each as {base, len} without following iov_base itself
+// (real strace only does that for small/known-safe syscalls).
+func renderIOVec(mem MemIO, addr, count uint64) string {
+	if count > maxIOVecEntries {
+		count = maxIOVecEntries
+	}
+	parts := make([]string, 0, count)
+	entry := make([]byte, iovecEntrySize)
+	for i := uint64(0); i < count; i++ {
+		if mem.Read(addr+i*iovecEntrySize, entry) != nil {
+			break
+		}
+		base := binary.LittleEndian.Uint64(entry[0:8])
+		iovLen := binary.LittleEndian.Uint64(entry[8:16])
+		parts = append(parts, fmt.Sprintf("{%#x, %d}", base, iovLen))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func joinHex(args []uint64) string {
+	strs := make([]string, len(args))
+	for i, v := range args {
+		strs[i] = fmt.Sprintf("%#x", v)
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,38 @@
+// Package linux provides the syscall table models.OS needs for
+// SyscallName/Strace on Linux targets.
+package linux
+
+import "github.com/lunixbochs/usercorn/go/kernel/common"
+
+// Syscalls is the x86_64 Linux syscall table, covering the calls common
+// enough to show up in most traces. Numbers and argument order match the
+// Linux x86_64 syscall ABI (arch/x86/entry/syscalls/syscall_64.tbl);
+// anything not listed here still traces, just without a resolved name or
+// pretty-printed args.
+var Syscalls = common.Table{
+	0: {Name: "read", Args: []common.ArgSpec{
+		{Kind: common.ArgInt}, {Kind: common.ArgBuf, LenArg: 2}, {Kind: common.ArgInt},
+	}},
+	1: {Name: "write", Args: []common.ArgSpec{
+		{Kind: common.ArgInt}, {Kind: common.ArgBuf, LenArg: 2}, {Kind: common.ArgInt},
+	}},
+	2: {Name: "open", Args: []common.ArgSpec{
+		{Kind: common.ArgStr}, {Kind: common.ArgInt}, {Kind: common.ArgInt},
+	}},
+	3: {Name: "close", Args: []common.ArgSpec{{Kind: common.ArgInt}}},
+	9: {Name: "mmap"},
+	19: {Name: "readv", Args: []common.ArgSpec{
+		{Kind: common.ArgInt}, {Kind: common.ArgIOVec, LenArg: 2}, {Kind: common.ArgInt},
+	}},
+	20: {Name: "writev", Args: []common.ArgSpec{
+		{Kind: common.ArgInt}, {Kind: common.ArgIOVec, LenArg: 2}, {Kind: common.ArgInt},
+	}},
+	41: {Name: "socket", Args: []common.ArgSpec{
+		{Kind: common.ArgInt}, {Kind: common.ArgInt}, {Kind: common.ArgInt},
+	}},
+	42: {Name: "connect", Args: []common.ArgSpec{
+		{Kind: common.ArgInt}, {Kind: common.ArgSockaddr, LenArg: 2}, {Kind: common.ArgInt},
+	}},
+	60:  {Name: "exit", Args: []common.ArgSpec{{Kind: common.ArgInt}}},
+	231: {Name: "exit_group", Args: []common.ArgSpec{{Kind: common.ArgInt}}},
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DisasFilter rewrites an already-disassembled instruction string. It
+// runs after Disas() so that a UI can offer operand simplification
+// (dword ptr [eax + 8] -> [eax+8]), symbol resolution, and immediate
+// annotation without touching the disassembler itself.
+type DisasFilter func(pc uint64, dis string, arch *Arch, os *OS) string
+
+// DisasChain runs a list of DisasFilter in order, each seeing the
+// previous filter's output, so callers can opt in/out per-filter.
+type DisasChain []DisasFilter
+
+func (c DisasChain) Apply(pc uint64, dis string, arch *Arch, os *OS) string {
+	for _, f := range c {
+		dis = f(pc, dis, arch, os)
+	}
+	return dis
+}
+
+var x86SizePrefixes = []string{"qword ptr ", "dword ptr ", "word ptr ", "byte ptr "}
+
+// x86WidthChangingMnemonics are instructions whose destination width
+// doesn't match the source operand's, so the size qualifier carries real
+// information and must survive simplification (e.g. "movzx eax, byte ptr
+// [ebx]" would otherwise lose the fact that only one byte is loaded).
+var x86WidthChangingMnemonics = map[string]bool{
+	"movzx":     true,
+	"movsx":     true,
+	"movsxd":    true,
+	"cvtsi2sd":  true,
+	"cvtsi2ss":  true,
+	"cvttsd2si": true,
+	"cvttss2si": true,
+}
+
+// X86SimplifyOperands strips redundant size qualifiers (the destination
+// register already implies the width) and removes spaces inside memory
+// operands: "mov eax, dword ptr [eax + 8]" -> "mov eax, [eax+8]". Mnemonics
+// in x86WidthChangingMnemonics are left alone, since their size qualifier is
+// the only thing that still distinguishes the source width from the
+// destination's.
+func X86SimplifyOperands(pc uint64, dis string, arch *Arch, os *OS) string {
+	mnemonic, operands := dis, ""
+	if i := strings.IndexByte(dis, ' '); i >= 0 {
+		mnemonic, operands = dis[:i], dis[i+1:]
+	}
+	// only a register destination implies the width; a memory destination
+	// ("mov dword ptr [eax], 1", "push dword ptr [eax]") keeps its qualifier
+	dst := strings.SplitN(operands, ",", 2)[0]
+	dstIsReg := dst != "" && !strings.Contains(dst, "ptr") && !strings.Contains(dst, "[")
+	if dstIsReg && !x86WidthChangingMnemonics[mnemonic] {
+		for _, p := range x86SizePrefixes {
+			dis = strings.Replace(dis, p, "", -1)
+		}
+	}
+	return stripBracketSpaces(dis)
+}
+
+// stripBracketSpaces removes spaces inside [...] memory operands while
+// leaving the rest of the instruction (mnemonic/operand separators)
+// untouched.
+func stripBracketSpaces(dis string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range dis {
+		switch r {
+		case '[':
+			depth++
+			b.WriteRune(r)
+		case ']':
+			depth--
+			b.WriteRune(r)
+		case ' ':
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// pcRelRe matches a bare hex address operand, e.g. the target of a call/jmp
+// or a rip-relative load once the disassembler has already resolved it to
+// an absolute address: "call 0x401008" or "[0x401008]". The captured prefix
+// must not be '+'/'-' (or a word char), so an arithmetic displacement like
+// the "0x8" in "[ebx+0x8]" is never mistaken for a standalone address.
+var pcRelRe = regexp.MustCompile(`(^|[^+\-\w])(0x[0-9a-fA-F]+)`)
+
+// SymbolFilter folds resolved addresses into "sym+offset" using the
+// OS's symbol table, when one is available.
+func SymbolFilter(pc uint64, dis string, arch *Arch, os *OS) string {
+	if os == nil {
+		return dis
+	}
+	return pcRelRe.ReplaceAllStringFunc(dis, func(match string) string {
+		sub := pcRelRe.FindStringSubmatch(match)
+		prefix, hex := sub[1], sub[2]
+		addr, err := strconv.ParseUint(hex[2:], 16, 64)
+		if err != nil {
+			return match
+		}
+		sym, off := os.Symbolicate(addr)
+		if sym == "" {
+			return match
+		}
+		if off == 0 {
+			return prefix + sym
+		}
+		return prefix + fmt.Sprintf("%s+%#x", sym, off)
+	})
+}
+
+// immRe matches a trailing immediate operand, e.g. the "0x3b" in
+// "mov eax, 0x3b".
+var immRe = regexp.MustCompile(`(?:,\s*|\s)(0x[0-9a-fA-F]+|\d+)$`)
+
+// SyscallImmFilter annotates trailing immediates that match a known
+// syscall number for the traced OS, e.g. "mov eax, 0x3c ; exit" with
+// kernel/linux.Syscalls.
+func SyscallImmFilter(pc uint64, dis string, arch *Arch, os *OS) string {
+	if os == nil {
+		return dis
+	}
+	m := immRe.FindStringSubmatch(dis)
+	if m == nil {
+		return dis
+	}
+	n, err := strconv.ParseInt(m[1], 0, 64)
+	if err != nil {
+		return dis
+	}
+	name := os.SyscallName(int(n))
+	if name == "" {
+		return dis
+	}
+	return fmt.Sprintf("%s ; %s", dis, name)
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/lunixbochs/usercorn/go/kernel/linux"
+)
+
+// golden disassembly samples for each arch this filter chain is expected to
+// run against. Only x86/x86_64 syntax has size qualifiers to strip; arm/
+// arm64 samples are included to pin down that the filter only removes
+// spaces inside brackets there and leaves the rest of the operands alone.
+var x86SimplifyGolden = []struct {
+	arch string
+	in   string
+	want string
+}{
+	{"x86", "mov eax, dword ptr [ebx + 8]", "mov eax, [ebx+8]"},
+	{"x86", "mov al, byte ptr [esi]", "mov al, [esi]"},
+	{"x86_64", "mov rax, qword ptr [rbx + rcx*4 + 0x10]", "mov rax, [rbx+rcx*4+0x10]"},
+	// width-changing mnemonics must keep their size qualifier
+	{"x86", "movzx eax, byte ptr [ebx]", "movzx eax, byte ptr [ebx]"},
+	{"x86_64", "movsx rax, word ptr [rbx]", "movsx rax, word ptr [rbx]"},
+	// X86SimplifyOperands doesn't check arch, so arm/arm64 samples still get
+	// stripBracketSpaces applied; they just never match an x86 size prefix
+	{"arm", "ldr r0, [r1, #8]", "ldr r0, [r1,#8]"},
+	{"arm64", "ldr x0, [x1, #16]", "ldr x0, [x1,#16]"},
+}
+
+func TestX86SimplifyOperands(t *testing.T) {
+	for _, c := range x86SimplifyGolden {
+		got := X86SimplifyOperands(0, c.in, nil, nil)
+		if got != c.want {
+			t.Errorf("%s: X86SimplifyOperands(%q) = %q, want %q", c.arch, c.in, got, c.want)
+		}
+	}
+}
+
+func TestStripBracketSpaces(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"mov eax, [ebx + 8]", "mov eax, [ebx+8]"},
+		{"mov eax, ebx", "mov eax, ebx"},
+		{"ldr r0, [r1, #8]", "ldr r0, [r1,#8]"},
+	}
+	for _, c := range cases {
+		if got := stripBracketSpaces(c.in); got != c.want {
+			t.Errorf("stripBracketSpaces(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFiltersNoOSPassthrough(t *testing.T) {
+	dis := "mov eax, 0x3b"
+	if got := SyscallImmFilter(0, dis, nil, nil); got != dis {
+		t.Errorf("SyscallImmFilter with nil os = %q, want unchanged %q", got, dis)
+	}
+	if got := SymbolFilter(0, dis, nil, nil); got != dis {
+		t.Errorf("SymbolFilter with nil os = %q, want unchanged %q", got, dis)
+	}
+}
+
+// testOS builds an *OS with a small symbol table and the real Linux syscall
+// table, so SymbolFilter/SyscallImmFilter can be exercised against actual
+// resolution instead of just the os == nil passthrough above.
+func testOS() *OS {
+	return &OS{
+		Syscalls: linux.Syscalls,
+		Symbols: []Symbol{
+			{Name: "main", Addr: 0x401000, Size: 0x20},
+			{Name: "puts", Addr: 0x401020, Size: 0x10},
+		},
+	}
+}
+
+var symbolFilterGolden = []struct {
+	name string
+	in   string
+	want string
+}{
+	{"bare symbol, zero offset", "call 0x401000", "call main"},
+	{"symbol plus offset", "call 0x401008", "call main+0x8"},
+	{"second symbol", "jmp 0x401020", "jmp puts"},
+	{"address outside any symbol", "call 0x402000", "call 0x402000"},
+	{
+		"bracket displacement is not a call target and must not be folded",
+		"mov eax, [ebx+0x8]",
+		"mov eax, [ebx+0x8]",
+	},
+	{
+		"resolved address inside brackets still folds",
+		"mov eax, [0x401008]",
+		"mov eax, [main+0x8]",
+	},
+}
+
+func TestSymbolFilter(t *testing.T) {
+	os := testOS()
+	for _, c := range symbolFilterGolden {
+		if got := SymbolFilter(0, c.in, nil, os); got != c.want {
+			t.Errorf("%s: SymbolFilter(%q) = %q, want %q", c.name, c.in, got, c.want)
+		}
+	}
+}
+
+func TestSyscallImmFilter(t *testing.T) {
+	os := testOS()
+	dis := "mov eax, 0x3c"
+	want := "mov eax, 0x3c ; exit"
+	if got := SyscallImmFilter(0, dis, nil, os); got != want {
+		t.Errorf("SyscallImmFilter(%q) = %q, want %q", dis, got, want)
+	}
+
+	unknown := "mov eax, 0x999"
+	if got := SyscallImmFilter(0, unknown, nil, os); got != unknown {
+		t.Errorf("SyscallImmFilter(%q) with unknown syscall = %q, want unchanged %q", unknown, got, unknown)
+	}
+}
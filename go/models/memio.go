@@ -0,0 +1,10 @@
+package models
+
+// MemIO is the minimal read/write interface anything that dereferences
+// pointers (e.g. OS.Strace's syscall args) needs, so callers can
+// pass either the live emulator's memory or a replayed MemSim without the
+// callee caring which.
+type MemIO interface {
+	Read(addr uint64, p []byte) error
+	Write(addr uint64, p []byte) error
+}
@@ -0,0 +1,38 @@
+package models
+
+import "github.com/lunixbochs/usercorn/go/kernel/common"
+
+// SyscallName resolves num against the syscall table the per-OS kernel
+// package registered on o.Syscalls (e.g. kernel/linux.Syscalls), returning
+// "" if num is unknown.
+func (o *OS) SyscallName(num int) string {
+	return common.SyscallName(o.Syscalls, num)
+}
+
+// Strace renders a syscall call in strace(1) style, dereferencing pointer
+// arguments (paths, buffers, ...) from mem rather than whatever MemIO the
+// syscall actually ran against, so this also works against a replayed
+// MemSim during trace playback.
+func (o *OS) Strace(num int, args []uint64, ret uint64, mem MemIO) string {
+	return common.Strace(o.Syscalls, num, args, ret, mem)
+}
+
+// Symbol is one entry in an OS's symbol table, covering the range
+// [Addr, Addr+Size).
+type Symbol struct {
+	Name string
+	Addr uint64
+	Size uint64
+}
+
+// Symbolicate finds the Symbol containing addr and returns its name and
+// addr's offset into it, or ("", 0) if addr falls outside every symbol in
+// o.Symbols.
+func (o *OS) Symbolicate(addr uint64) (string, uint64) {
+	for _, sym := range o.Symbols {
+		if addr >= sym.Addr && addr < sym.Addr+sym.Size {
+			return sym.Name, addr - sym.Addr
+		}
+	}
+	return "", 0
+}
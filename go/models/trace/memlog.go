@@ -0,0 +1,99 @@
+package trace
+
+import "bytes"
+
+// MemExtent is a single coalesced memory range accumulated by MemLog.
+type MemExtent struct {
+	Addr  uint64
+	Data  []byte
+	Write bool
+}
+
+// end returns the address one past the extent.
+func (e MemExtent) end() uint64 { return e.Addr + uint64(len(e.Data)) }
+
+// MemLog accumulates memory reads/writes over a basic block, coalescing
+// adjacent or overlapping ranges into single R/W extents. Writes are
+// diffed against the memory image in effect when they happened, so a
+// write that doesn't actually change anything (same value rewritten) is
+// dropped instead of cluttering the summary.
+//
+// This is the mlog2 filter referenced in stream.go: a block's memory
+// activity is pushed to the end and combined, rather than interleaved
+// one R/W line per instruction.
+type MemLog struct {
+	reads  []MemExtent
+	writes []MemExtent
+}
+
+func NewMemLog() *MemLog {
+	return &MemLog{}
+}
+
+// Read records a read of data at addr, merging it into any adjacent or
+// overlapping read extent already logged this block.
+func (m *MemLog) Read(addr uint64, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	m.reads = coalesce(m.reads, MemExtent{Addr: addr, Data: append([]byte{}, data...)})
+}
+
+// Write records a write of data at addr. old must be the bytes addr
+// held immediately before the write (the caller reads this from its
+// memory simulator before applying the write); if the write doesn't
+// actually change those bytes, it's dropped as redundant.
+func (m *MemLog) Write(addr uint64, data, old []byte) {
+	if len(data) == 0 || bytes.Equal(data, old) {
+		return
+	}
+	m.writes = coalesce(m.writes, MemExtent{Addr: addr, Data: append([]byte{}, data...), Write: true})
+}
+
+// Reads returns the coalesced read extents logged since the last Reset.
+func (m *MemLog) Reads() []MemExtent { return m.reads }
+
+// Writes returns the coalesced, de-duplicated write extents logged
+// since the last Reset.
+func (m *MemLog) Writes() []MemExtent { return m.writes }
+
+// Empty reports whether the log has nothing worth summarizing.
+func (m *MemLog) Empty() bool { return len(m.reads) == 0 && len(m.writes) == 0 }
+
+// Reset clears the log for the next basic block.
+func (m *MemLog) Reset() {
+	m.reads = m.reads[:0]
+	m.writes = m.writes[:0]
+}
+
+// coalesce merges next with every existing extent it's adjacent to or
+// overlaps (so a range bridging two extents joins them into one), removes
+// those extents, and appends the merged result; next's bytes win where
+// they overlap older data.
+func coalesce(extents []MemExtent, next MemExtent) []MemExtent {
+	for i := 0; i < len(extents); {
+		e := extents[i]
+		if next.Addr <= e.end() && e.Addr <= next.end() {
+			next = mergeExtent(e, next)
+			extents = append(extents[:i], extents[i+1:]...)
+			continue
+		}
+		i++
+	}
+	return append(extents, next)
+}
+
+func mergeExtent(a, b MemExtent) MemExtent {
+	start := a.Addr
+	if b.Addr < start {
+		start = b.Addr
+	}
+	end := a.end()
+	if b.end() > end {
+		end = b.end()
+	}
+	data := make([]byte, end-start)
+	copy(data[a.Addr-start:], a.Data)
+	copy(data[b.Addr-start:], b.Data)
+	return MemExtent{Addr: start, Data: data, Write: a.Write || b.Write}
+}
@@ -0,0 +1,267 @@
+package trace
+
+import (
+	"fmt"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// FrameState holds enough state to resume forward replay from a given
+// point in the trace, either a keyframe or the result of replaying up to
+// some frame in between.
+type FrameState struct {
+	Regs   map[int]uint64
+	SpRegs map[int][]byte
+	PC, SP uint64
+	Mem    *models.MemSim
+}
+
+func (f *FrameState) clone() *FrameState {
+	regs := make(map[int]uint64, len(f.Regs))
+	for k, v := range f.Regs {
+		regs[k] = v
+	}
+	spregs := make(map[int][]byte, len(f.SpRegs))
+	for k, v := range f.SpRegs {
+		spregs[k] = append([]byte{}, v...)
+	}
+	// f.Mem.Clone() deep-copies the backing store; a shallow struct copy
+	// would alias it, so writes made after this snapshot would retroactively
+	// mutate the "frozen" keyframe.
+	return &FrameState{Regs: regs, SpRegs: spregs, PC: f.PC, SP: f.SP, Mem: f.Mem.Clone()}
+}
+
+// regUndo and memUndo record the value a forward step clobbered, so a
+// single StepBack() can restore it without replaying from the nearest
+// keyframe.
+type regUndo struct {
+	Num int
+	Val uint64
+}
+
+type memUndo struct {
+	Addr uint64
+	Old  []byte
+}
+
+// frame bundles the ops that occurred at a single instruction (an
+// OpStep plus any side-effects queued alongside it) together with the
+// undo records generated when those ops were first applied.
+type frame struct {
+	ops  []models.Op
+	regs []regUndo
+	mem  []memUndo
+}
+
+// TracePlayer consumes the same Op stream as ui.StreamUI, but keeps a
+// keyframe index plus per-frame undo records so it can seek, rewind and
+// fast-forward through a trace without re-running the emulator.
+type TracePlayer struct {
+	Arch *models.Arch
+
+	// keyframes maps a frame number (see frame, below) to the state
+	// snapshot in effect right as that keyframe was processed.
+	keyframes map[int64]*FrameState
+	order     []int64 // keyframe frame numbers, ascending
+
+	frames []frame // frames[i] holds the ops/undo for frame i
+	frame  int64   // current frame number (len(frames) once fully fed)
+
+	cur *FrameState
+}
+
+func NewTracePlayer(arch *models.Arch) *TracePlayer {
+	return &TracePlayer{
+		Arch:      arch,
+		keyframes: make(map[int64]*FrameState),
+		cur: &FrameState{
+			Regs:   make(map[int]uint64),
+			SpRegs: make(map[int][]byte),
+			Mem:    &models.MemSim{},
+		},
+	}
+}
+
+// Feed appends an Op to the player's history, advancing the current
+// frame on OpStep and recording a keyframe snapshot on OpKeyframe.
+func (t *TracePlayer) Feed(op models.Op) {
+	switch o := op.(type) {
+	case *OpKeyframe:
+		// Apply the dump straight to t.cur via replay (forward-only, no undo,
+		// no t.frames bucket) rather than t.apply. A keyframe is a periodic
+		// full-state re-sync, not a traced instruction: if its ops shared the
+		// current frame bucket with whatever real instruction follows, the
+		// snapshot taken below (which only reflects the dump) and the
+		// replay/undo data recorded for that bucket (which would then also
+		// include the dump) would disagree about what frame `t.frame` holds.
+		for _, v := range o.Ops {
+			replay(t.cur, t.Arch, v)
+		}
+		t.snapshotKeyframe()
+		return
+	case *OpStep:
+		t.apply(t.frame, o)
+		t.frame++
+		return
+	default:
+		t.apply(t.frame, op)
+	}
+}
+
+func (t *TracePlayer) snapshotKeyframe() {
+	t.keyframes[t.frame] = t.cur.clone()
+	t.order = append(t.order, t.frame)
+}
+
+// apply plays a single op forward against t.cur, recording whatever
+// undo information is needed to unwind it again in StepBack.
+func (t *TracePlayer) apply(frameNum int64, op models.Op) {
+	idx := int(frameNum)
+	for idx >= len(t.frames) {
+		t.frames = append(t.frames, frame{})
+	}
+	f := &t.frames[idx]
+	f.ops = append(f.ops, op)
+
+	switch o := op.(type) {
+	case *OpJmp:
+		t.cur.PC = o.Addr
+	case *OpStep:
+		t.cur.PC += uint64(o.Size)
+	case *OpReg:
+		f.regs = append(f.regs, regUndo{Num: int(o.Num), Val: t.cur.Regs[int(o.Num)]})
+		if int(o.Num) == t.Arch.SP {
+			t.cur.SP = o.Val
+		}
+		t.cur.Regs[int(o.Num)] = o.Val
+	case *OpSpReg:
+		t.cur.SpRegs[int(o.Num)] = o.Val
+	case *OpMemMap:
+		t.cur.Mem.Map(o.Addr, uint64(o.Size), int(o.Prot), o.Zero != 0)
+	case *OpMemUnmap:
+		t.cur.Mem.Unmap(o.Addr, uint64(o.Size))
+	case *OpMemWrite:
+		old := make([]byte, len(o.Data))
+		t.cur.Mem.Read(o.Addr, old)
+		f.mem = append(f.mem, memUndo{Addr: o.Addr, Old: old})
+		t.cur.Mem.Write(o.Addr, o.Data)
+	case *OpSyscall:
+		for _, v := range o.Ops {
+			t.apply(frameNum, v)
+		}
+	}
+}
+
+// nearestKeyframe returns the largest keyframe frame number <= n.
+func (t *TracePlayer) nearestKeyframe(n int64) (int64, bool) {
+	best, ok := int64(0), false
+	for _, k := range t.order {
+		if k <= n && (!ok || k > best) {
+			best, ok = k, true
+		}
+	}
+	return best, ok
+}
+
+// SeekFrame reconstructs state as of frame n by restoring the nearest
+// prior keyframe and re-applying OpStep/OpReg/OpMem* forward from there.
+func (t *TracePlayer) SeekFrame(n int64) (*FrameState, error) {
+	if n < 0 || n > int64(len(t.frames)) {
+		return nil, fmt.Errorf("trace: frame %d out of range", n)
+	}
+	start, ok := t.nearestKeyframe(n)
+	if !ok {
+		return nil, fmt.Errorf("trace: no keyframe at or before frame %d", n)
+	}
+	// t.keyframes[start] is a full snapshot as of frame start with no ops of
+	// its own recorded in t.frames (see Feed's OpKeyframe case), so replay
+	// starts at frame start itself rather than start+1.
+	snap := t.keyframes[start].clone()
+	for i := start; i < n; i++ {
+		for _, op := range t.frames[i].ops {
+			replay(snap, t.Arch, op)
+		}
+	}
+	t.cur = snap
+	t.frame = n
+	return t.cur, nil
+}
+
+// replay applies a single previously-seen op to snap, used by SeekFrame
+// to fast-forward from a keyframe without recording new undo data.
+func replay(snap *FrameState, arch *models.Arch, op models.Op) {
+	switch o := op.(type) {
+	case *OpJmp:
+		snap.PC = o.Addr
+	case *OpStep:
+		snap.PC += uint64(o.Size)
+	case *OpReg:
+		if int(o.Num) == arch.SP {
+			snap.SP = o.Val
+		}
+		snap.Regs[int(o.Num)] = o.Val
+	case *OpSpReg:
+		snap.SpRegs[int(o.Num)] = o.Val
+	case *OpMemMap:
+		snap.Mem.Map(o.Addr, uint64(o.Size), int(o.Prot), o.Zero != 0)
+	case *OpMemUnmap:
+		snap.Mem.Unmap(o.Addr, uint64(o.Size))
+	case *OpMemWrite:
+		snap.Mem.Write(o.Addr, o.Data)
+	case *OpSyscall:
+		for _, v := range o.Ops {
+			replay(snap, arch, v)
+		}
+	}
+}
+
+// StepBack unwinds the current frame using its recorded undo records,
+// avoiding a full replay from the last keyframe.
+func (t *TracePlayer) StepBack() (*FrameState, error) {
+	if t.frame <= 0 {
+		return nil, fmt.Errorf("trace: already at frame 0")
+	}
+	t.frame--
+	f := t.frames[t.frame]
+	for i := len(f.mem) - 1; i >= 0; i-- {
+		u := f.mem[i]
+		t.cur.Mem.Write(u.Addr, u.Old)
+	}
+	for i := len(f.regs) - 1; i >= 0; i-- {
+		u := f.regs[i]
+		t.cur.Regs[u.Num] = u.Val
+		if u.Num == t.Arch.SP {
+			t.cur.SP = u.Val
+		}
+	}
+	for _, op := range f.ops {
+		if o, ok := op.(*OpStep); ok {
+			t.cur.PC -= uint64(o.Size)
+		}
+	}
+	return t.cur, nil
+}
+
+// StepForward re-applies the next frame's ops on top of the current
+// state, the cheap inverse of StepBack.
+func (t *TracePlayer) StepForward() (*FrameState, error) {
+	if int(t.frame) >= len(t.frames) {
+		return nil, fmt.Errorf("trace: already at last frame")
+	}
+	for _, op := range t.frames[t.frame].ops {
+		replay(t.cur, t.Arch, op)
+	}
+	t.frame++
+	return t.cur, nil
+}
+
+// Frame returns the current frame number and the total number of
+// frames fed so far.
+func (t *TracePlayer) Frame() (cur, total int64) {
+	return t.frame, int64(len(t.frames))
+}
+
+// State returns the player's current reconstructed state.
+func (t *TracePlayer) State() *FrameState {
+	return t.cur
+}
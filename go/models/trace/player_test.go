@@ -0,0 +1,110 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// newTestPlayer returns a TracePlayer over a minimal Arch; none of these
+// tests touch the stack register or memory, so SP's value doesn't matter.
+func newTestPlayer() *TracePlayer {
+	return NewTracePlayer(&models.Arch{SP: 0})
+}
+
+// TestSeekFrameAcrossKeyframe reproduces a keyframe immediately followed by
+// a real instruction that writes the same register the keyframe dumped:
+// keyframe sets reg1=0x10, the next instruction sets reg1=0x20 then steps.
+// SeekFrame(1) (the state after that one real instruction) must see 0x20,
+// and SeekFrame(0) (the keyframe's own checkpoint) must still see 0x10.
+func TestSeekFrameAcrossKeyframe(t *testing.T) {
+	p := newTestPlayer()
+	p.Feed(&OpKeyframe{Ops: []models.Op{&OpReg{Num: 1, Val: 0x10}}})
+	p.Feed(&OpReg{Num: 1, Val: 0x20})
+	p.Feed(&OpStep{Size: 4})
+
+	snap, err := p.SeekFrame(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Regs[1] != 0x20 {
+		t.Fatalf("SeekFrame(1).Regs[1] = %#x, want 0x20", snap.Regs[1])
+	}
+
+	snap, err = p.SeekFrame(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Regs[1] != 0x10 {
+		t.Fatalf("SeekFrame(0).Regs[1] = %#x, want 0x10 (the keyframe's own baseline)", snap.Regs[1])
+	}
+}
+
+// TestStepBackAcrossKeyframe checks that stepping back across the boundary
+// between a keyframe and the instruction right after it restores exactly
+// the keyframe's baseline, not a zero value from further back.
+func TestStepBackAcrossKeyframe(t *testing.T) {
+	p := newTestPlayer()
+	p.Feed(&OpKeyframe{Ops: []models.Op{&OpReg{Num: 1, Val: 0x10}}})
+	p.Feed(&OpReg{Num: 1, Val: 0x20})
+	p.Feed(&OpStep{Size: 4})
+
+	if got := p.State().Regs[1]; got != 0x20 {
+		t.Fatalf("state after feed = %#x, want 0x20", got)
+	}
+
+	snap, err := p.StepBack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Regs[1] != 0x10 {
+		t.Fatalf("StepBack crossed the keyframe boundary: Regs[1] = %#x, want 0x10", snap.Regs[1])
+	}
+}
+
+// TestNearestKeyframe exercises the keyframe lookup SeekFrame relies on.
+func TestNearestKeyframe(t *testing.T) {
+	p := newTestPlayer()
+	p.order = []int64{0, 3, 7}
+	cases := []struct {
+		n      int64
+		want   int64
+		wantOK bool
+	}{
+		{0, 0, true},
+		{5, 3, true},
+		{7, 7, true},
+		{8, 7, true},
+		{-1, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := p.nearestKeyframe(c.n)
+		if ok != c.wantOK || (ok && got != c.want) {
+			t.Errorf("nearestKeyframe(%d) = (%d, %v), want (%d, %v)", c.n, got, ok, c.want, c.wantOK)
+		}
+	}
+}
+
+// TestStepForwardThenBack checks the plain (no keyframe) step/undo path
+// still round-trips a register write.
+func TestStepForwardThenBack(t *testing.T) {
+	p := newTestPlayer()
+	p.Feed(&OpReg{Num: 2, Val: 0x42})
+	p.Feed(&OpStep{Size: 2})
+
+	if got := p.State().Regs[2]; got != 0x42 {
+		t.Fatalf("state after feed = %#x, want 0x42", got)
+	}
+	if _, err := p.StepBack(); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.State().Regs[2]; got != 0 {
+		t.Fatalf("state after StepBack = %#x, want 0", got)
+	}
+	if _, err := p.StepForward(); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.State().Regs[2]; got != 0x42 {
+		t.Fatalf("state after StepForward = %#x, want 0x42", got)
+	}
+}
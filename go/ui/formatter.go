@@ -0,0 +1,243 @@
+package ui
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// RegDelta describes a single register write to be printed alongside an
+// instruction.
+type RegDelta struct {
+	Num  int
+	Name string
+	Val  uint64
+}
+
+// MemDelta describes a single memory access (read or write) to be
+// printed alongside an instruction.
+type MemDelta struct {
+	Addr  uint64
+	Data  []byte
+	Write bool
+}
+
+// Formatter turns the state StreamUI.Feed() already tracks into output.
+// TextFormatter reproduces the original column-aligned text; JSONFormatter
+// emits newline-delimited JSON so other tooling (differential execution
+// analysis, taint tracking, replay harnesses) can consume usercorn traces
+// without scraping text.
+type Formatter interface {
+	Block(pc uint64)
+	Instruction(pc uint64, bytes []byte, dis string, regs []RegDelta)
+	// MemSummary reports a basic block's coalesced, de-duplicated memory
+	// activity (see trace.MemLog) once the block finishes, instead of
+	// interleaving a line per byte read/written. pc is the block's address
+	// (the same value its Block call got), so a consumer can attribute the
+	// summary without relying on line ordering.
+	MemSummary(pc uint64, mem []MemDelta)
+	// Syscall reports a traced syscall. name is the resolved syscall
+	// name (empty if unknown); pretty is an optional strace-style
+	// rendering of the call with pointer args already dereferenced,
+	// supplied by the per-OS kernel common package.
+	Syscall(num uint64, args []uint64, ret uint64, name, pretty string)
+}
+
+// TextFormatter is the original StreamUI output: one padded line per
+// instruction, with register side-effects in trailing columns; memory
+// side-effects are printed per block by MemSummary instead.
+type TextFormatter struct {
+	w      io.Writer
+	Arch   *models.Arch
+	regfmt string
+	inscol int
+	regcol int
+}
+
+func NewTextFormatter(w io.Writer, arch *models.Arch) *TextFormatter {
+	longest := 0
+	for _, name := range arch.RegNames() {
+		if len(name) > longest {
+			longest = len(name)
+		}
+	}
+	return &TextFormatter{
+		w:      w,
+		Arch:   arch,
+		regfmt: fmt.Sprintf("%%%ds = %%#0%dx", longest, arch.Bits/4),
+		inscol: 60, // FIXME
+		regcol: longest + 5 + arch.Bits/4,
+	}
+}
+
+func (f *TextFormatter) Block(pc uint64) {
+	fmt.Fprintf(f.w, "\n%#x\n", pc)
+}
+
+func (f *TextFormatter) Instruction(pc uint64, bytes []byte, dis string, regs []RegDelta) {
+	ins := dis
+	if ins == "" {
+		ins = fmt.Sprintf("%#x: %x", pc, bytes)
+	}
+
+	var regStrs []string
+	for _, r := range regs {
+		name := r.Name
+		if name == "" {
+			name = strconv.Itoa(r.Num)
+		}
+		regStrs = append(regStrs, fmt.Sprintf(f.regfmt, name, r.Val))
+	}
+
+	var reg string
+	if len(regStrs) > 0 {
+		reg = regStrs[0] + pad(regStrs[0], f.regcol)
+	} else {
+		reg = strings.Repeat(" ", f.regcol)
+	}
+	ins += pad(ins, f.inscol)
+	fmt.Fprintf(f.w, "%s | %s\n", ins, reg)
+
+	if len(regStrs) > 1 {
+		inspad := strings.Repeat(" ", f.inscol)
+		for _, r := range regStrs[1:] {
+			fmt.Fprintf(f.w, "%s + %s\n", inspad, r)
+		}
+	}
+}
+
+// MemSummary prints a block's merged memory activity as a hexdump -C
+// style section, one extent at a time, instead of a line per access. pc is
+// not reprinted here since the preceding Block call already showed it.
+func (f *TextFormatter) MemSummary(pc uint64, mem []MemDelta) {
+	for _, m := range mem {
+		dir := "R"
+		if m.Write {
+			dir = "W"
+		}
+		fmt.Fprintf(f.w, "%s %#x (%d bytes)\n", dir, m.Addr, len(m.Data))
+		for _, line := range models.HexDump(m.Addr, m.Data, f.Arch.Bits) {
+			fmt.Fprintln(f.w, line)
+		}
+	}
+}
+
+func (f *TextFormatter) Syscall(num uint64, args []uint64, ret uint64, name, pretty string) {
+	// pretty is the strace-style rendering from the per-OS kernel common
+	// package (pointer args dereferenced against traced memory); fall
+	// back to raw hex args if the caller didn't have one
+	if pretty != "" {
+		fmt.Fprintf(f.w, "%s\n", pretty)
+		return
+	}
+	strArgs := make([]string, len(args))
+	for i, v := range args {
+		strArgs[i] = fmt.Sprintf("%#x", v)
+	}
+	if name == "" {
+		name = strconv.FormatUint(num, 10)
+	}
+	fmt.Fprintf(f.w, "%s(%s) = %d\n", name, strings.Join(strArgs, ", "), ret)
+}
+
+// JSONFormatter emits one JSON object per line: a block boundary is
+// folded into the next instruction record via BlockPC, so downstream
+// tooling gets a flat, greppable stream instead of needing to track
+// state across lines.
+type JSONFormatter struct {
+	w   io.Writer
+	enc *json.Encoder
+
+	blockPC   uint64
+	haveBlock bool
+}
+
+func NewJSONFormatter(w io.Writer) *JSONFormatter {
+	return &JSONFormatter{w: w, enc: json.NewEncoder(w)}
+}
+
+type jsonReg struct {
+	Name string `json:"name,omitempty"`
+	Num  int    `json:"num"`
+	Val  uint64 `json:"val"`
+}
+
+type jsonMem struct {
+	Addr uint64 `json:"addr"`
+	Data string `json:"data,omitempty"`
+}
+
+type jsonRecord struct {
+	BlockPC   *uint64   `json:"block_pc,omitempty"`
+	PC        uint64    `json:"pc"`
+	Bytes     string    `json:"bytes,omitempty"`
+	Disasm    string    `json:"disasm,omitempty"`
+	RegWrites []jsonReg `json:"reg_writes,omitempty"`
+}
+
+func (f *JSONFormatter) Block(pc uint64) {
+	f.blockPC = pc
+	f.haveBlock = true
+}
+
+func (f *JSONFormatter) Instruction(pc uint64, bytes []byte, dis string, regs []RegDelta) {
+	rec := jsonRecord{
+		PC:     pc,
+		Bytes:  hex.EncodeToString(bytes),
+		Disasm: dis,
+	}
+	if f.haveBlock {
+		rec.BlockPC = &f.blockPC
+		f.haveBlock = false
+	}
+	for _, r := range regs {
+		rec.RegWrites = append(rec.RegWrites, jsonReg{Name: r.Name, Num: r.Num, Val: r.Val})
+	}
+	f.enc.Encode(&rec)
+}
+
+type jsonMemSummary struct {
+	BlockPC   uint64    `json:"block_pc"`
+	MemReads  []jsonMem `json:"mem_reads,omitempty"`
+	MemWrites []jsonMem `json:"mem_writes,omitempty"`
+}
+
+// MemSummary emits the merged, de-duplicated memory activity for the block
+// that just finished as its own record, mirroring trace.MemLog's coalesced
+// reads/writes rather than one record per byte. BlockPC is carried on the
+// record (rather than left to line ordering) so a JSONL consumer can
+// attribute it to the block it came from.
+func (f *JSONFormatter) MemSummary(pc uint64, mem []MemDelta) {
+	var reads, writes []jsonMem
+	for _, m := range mem {
+		jm := jsonMem{Addr: m.Addr, Data: hex.EncodeToString(m.Data)}
+		if m.Write {
+			writes = append(writes, jm)
+		} else {
+			reads = append(reads, jm)
+		}
+	}
+	if len(reads) == 0 && len(writes) == 0 {
+		return
+	}
+	f.enc.Encode(&jsonMemSummary{BlockPC: pc, MemReads: reads, MemWrites: writes})
+}
+
+type jsonSyscall struct {
+	Num    uint64   `json:"num"`
+	Name   string   `json:"name,omitempty"`
+	Args   []uint64 `json:"args"`
+	Ret    uint64   `json:"ret"`
+	Strace string   `json:"strace,omitempty"`
+}
+
+func (f *JSONFormatter) Syscall(num uint64, args []uint64, ret uint64, name, pretty string) {
+	f.enc.Encode(&struct {
+		Syscall jsonSyscall `json:"syscall"`
+	}{jsonSyscall{Num: num, Name: name, Args: args, Ret: ret, Strace: pretty}})
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"strconv"
@@ -25,23 +26,44 @@ type StreamUI struct {
 	SpRegs map[int][]byte
 	PC, SP uint64
 
-	w      io.Writer
-	regfmt string
-	inscol int
-	regcol int
+	w         io.Writer
+	formatter Formatter
+	// Filters runs over each instruction's disassembly after Disas(),
+	// e.g. models.X86SimplifyOperands or models.SymbolFilter. Empty by
+	// default; callers opt in per-filter.
+	Filters models.DisasChain
 	// pending is an OpStep representing the last unflushed instruction. Cleared by Flush().
 	pending *trace.OpStep
 	effects []models.Op
+
+	// blockBuf holds one entry per instruction since the last OpJmp;
+	// memlog holds that same span's memory activity, coalesced. Both
+	// are flushed together once the block closes, so memcpy/memset
+	// loops produce one merged hex-dump instead of a line per byte.
+	blockBuf []blockIns
+	memlog   *trace.MemLog
+	// blockAddr is the address of the block currently being accumulated in
+	// blockBuf/memlog, set by blockPrint and read by memPrint so the
+	// MemSummary formatter call can be attributed to its block.
+	blockAddr uint64
+
+	// player mirrors the same Op stream into a trace.TracePlayer so
+	// Feed() can support SeekFrame/StepBack/StepForward on top of the
+	// usual forward-only printing.
+	player *trace.TracePlayer
 }
 
-func NewStreamUI(w io.Writer, arch *models.Arch, os *models.OS) *StreamUI {
-	// find the longest register name
-	longest := 0
-	for _, name := range arch.RegNames() {
-		if len(name) > longest {
-			longest = len(name)
-		}
-	}
+// blockIns is one buffered instruction awaiting blockFlush.
+type blockIns struct {
+	pc   uint64
+	size uint8
+	regs []RegDelta
+}
+
+// NewStreamUI builds a StreamUI that prints through formatter as it
+// consumes Feed()'s Op stream. Pass a *TextFormatter for the original
+// column-aligned output, or a *JSONFormatter for machine-readable JSONL.
+func NewStreamUI(w io.Writer, arch *models.Arch, os *models.OS, formatter Formatter) *StreamUI {
 	return &StreamUI{
 		Arch:   arch,
 		OS:     os,
@@ -49,17 +71,16 @@ func NewStreamUI(w io.Writer, arch *models.Arch, os *models.OS) *StreamUI {
 		Regs:   make(map[int]uint64),
 		SpRegs: make(map[int][]byte),
 
-		w:      w,
-		regfmt: fmt.Sprintf("%%%ds = %%#0%dx", longest, arch.Bits/4),
-		inscol: 60, // FIXME
-		regcol: longest + 5 + arch.Bits/4,
+		w:         w,
+		formatter: formatter,
+
+		memlog: trace.NewMemLog(),
+		player: trace.NewTracePlayer(arch),
 	}
 }
 
 // update() applies state change(s) from op to the UI's internal state
 func (s *StreamUI) update(op models.Op) {
-	// TODO: mlog2 will be a basic block filter
-	// all memory ops in a block are pushed to the end and combined using memlog
 	switch o := op.(type) {
 	case *trace.OpJmp:
 		s.PC = o.Addr
@@ -100,8 +121,10 @@ func (s *StreamUI) Feed(op models.Op) {
 	case *trace.OpKeyframe:
 		// we need to flush here, because the keyframe can change state we need to print
 		s.Flush()
-		// We only need the first keyframe for simple display (until we're doing rewind/ff)
-		// but it probably doesn't hurt too much for now to always process keyframes... just don't print them
+		// the player keeps every keyframe (and the ops since) so SeekFrame,
+		// StepBack and StepForward can reconstruct state after the fact;
+		// for live printing we still only care about the resulting state
+		s.player.Feed(o)
 		for _, v := range o.Ops {
 			s.update(v)
 		}
@@ -114,26 +137,33 @@ func (s *StreamUI) Feed(op models.Op) {
 		switch o := op.(type) {
 		case *trace.OpJmp:
 			s.Flush()
+			s.blockFlush()
 			s.blockPrint(o.Addr)
 			s.update(o)
+			s.player.Feed(o)
 		case *trace.OpStep:
 			s.Flush()
 			s.pending = o
 		case *trace.OpSyscall:
 			s.Flush()
 			s.sysPrint(o)
+			s.player.Feed(o)
 		default:
 			// queue everything else as side-effects
 			s.effects = append(s.effects, op)
+			s.player.Feed(op)
 		}
 	}
 }
 
-// Flush prints and clears the currently queued instruction and side-effects
+// Flush buffers the currently queued instruction (and logs its memory
+// side-effects) into the current block, to be printed by blockFlush
+// once the block closes. It does not print anything itself.
 func (s *StreamUI) Flush() {
 	if s.pending != nil {
-		s.insPrint(s.PC, s.pending.Size, s.effects)
+		s.blockBuf = append(s.blockBuf, s.logEffects(s.PC, s.pending.Size, s.effects))
 		s.update(s.pending)
+		s.player.Feed(s.pending)
 		for _, op := range s.effects {
 			s.update(op)
 		}
@@ -142,100 +172,191 @@ func (s *StreamUI) Flush() {
 	}
 }
 
-// blockPrint() takes a basic block address to pretty-print
-func (s *StreamUI) blockPrint(addr uint64) {
-	fmt.Fprintf(s.w, "\n%#x\n", addr)
+// blockFlush prints every instruction buffered since the last block
+// boundary, followed by one merged hex-dump section for the block's
+// memory activity, then resets both for the next block.
+func (s *StreamUI) blockFlush() {
+	for _, ins := range s.blockBuf {
+		s.insPrint(ins)
+	}
+	s.blockBuf = s.blockBuf[:0]
+	s.memPrint()
 }
 
-// sysPrint() takes a syscall op to pretty-print
-func (s *StreamUI) sysPrint(op *trace.OpSyscall) {
-	// FIXME: this is a regression, how do we strace?
-	// I think I need to embed the strace string during trace
-	// until I get a chance to rework the strace backend
-
-	// SECOND THOUGHT
-	// I just need to expose a method on models.OS to convert syscall number into name
-	// then I should be able to use the strace from kernel common
-	// except I need to be able to dependency-inject the MemIO (as we might be on MemSim)
-	args := make([]string, len(op.Args))
-	for i, v := range op.Args {
-		args[i] = fmt.Sprintf("%#x", v)
+// memPrint flushes the accumulated MemLog as a single formatter call.
+func (s *StreamUI) memPrint() {
+	if s.memlog.Empty() {
+		return
+	}
+	reads, writes := s.memlog.Reads(), s.memlog.Writes()
+	mem := make([]MemDelta, 0, len(reads)+len(writes))
+	for _, e := range reads {
+		mem = append(mem, MemDelta{Addr: e.Addr, Data: e.Data})
 	}
-	fmt.Fprintf(s.w, "syscall(%d, [%s]) = %d\n", op.Num, strings.Join(args, ", "), op.Ret)
+	for _, e := range writes {
+		mem = append(mem, MemDelta{Addr: e.Addr, Data: e.Data, Write: true})
+	}
+	s.formatter.MemSummary(s.blockAddr, mem)
+	s.memlog.Reset()
 }
 
-// insPrint() takes an instruction address and side-effects to pretty-print
-func (s *StreamUI) insPrint(pc uint64, size uint8, effects []models.Op) {
-	// TODO: make all of this into Sprintf columns, and align the columns
+// SeekFrame jumps the UI's view of Regs/SpRegs/PC/SP/Mem to frame n,
+// reconstructed by the underlying trace.TracePlayer. It does not undo
+// any printing already done; callers doing interactive rewind/ff
+// should re-print state themselves after calling this.
+func (s *StreamUI) SeekFrame(n int64) error {
+	snap, err := s.player.SeekFrame(n)
+	if err != nil {
+		return err
+	}
+	s.applySnapshot(snap)
+	return nil
+}
 
-	var ins string
-	insmem := make([]byte, size)
-	s.Mem.Read(pc, insmem)
-	// TODO: disBytes setting?
-	dis, err := models.Disas(insmem, pc, s.Arch, false)
+// StepBack rewinds the player by one instruction and updates the UI's
+// state to match.
+func (s *StreamUI) StepBack() error {
+	snap, err := s.player.StepBack()
+	if err != nil {
+		return err
+	}
+	s.applySnapshot(snap)
+	return nil
+}
+
+// StepForward replays the next instruction's effects and updates the
+// UI's state to match.
+func (s *StreamUI) StepForward() error {
+	snap, err := s.player.StepForward()
 	if err != nil {
-		ins = fmt.Sprintf("%#x: %x", pc, insmem)
-	} else {
-		ins = fmt.Sprintf("%s", dis)
+		return err
 	}
+	s.applySnapshot(snap)
+	return nil
+}
+
+func (s *StreamUI) applySnapshot(snap *trace.FrameState) {
+	s.Regs = snap.Regs
+	s.SpRegs = snap.SpRegs
+	s.PC = snap.PC
+	s.SP = snap.SP
+	s.Mem = snap.Mem
+}
+
+// Close flushes any buffered instruction and block left over once the
+// trace ends, so the last block isn't silently dropped.
+func (s *StreamUI) Close() {
+	s.Flush()
+	s.blockFlush()
+}
+
+// blockPrint() takes a basic block address, hands it to the formatter, and
+// remembers it so the next memPrint (for this new block) can attribute its
+// MemSummary call correctly.
+func (s *StreamUI) blockPrint(addr uint64) {
+	s.blockAddr = addr
+	s.formatter.Block(addr)
+}
+
+// sysPrint() takes a syscall op and hands it to the formatter.
+// Pointer args (paths, iovecs, sockaddrs, buffers) are dereferenced and
+// pretty-printed from s.Mem, which holds the memory state as of replay
+// time rather than whatever MemIO the syscall originally ran against.
+func (s *StreamUI) sysPrint(op *trace.OpSyscall) {
+	name := s.OS.SyscallName(int(op.Num))
+	pretty := s.OS.Strace(int(op.Num), op.Args, op.Ret, s.Mem)
+	s.formatter.Syscall(op.Num, op.Args, op.Ret, name, pretty)
+}
 
-	// collect effects (should just be memory IO and register changes)
-	var regs []string
-	var mem []string
+// logEffects splits an instruction's side-effects into the RegDelta
+// list it'll be printed with and the memory activity it contributes to
+// the block's MemLog. It must run before the effects are applied to
+// s.Mem, since MemLog.Write diffs against the bytes a write clobbers.
+func (s *StreamUI) logEffects(pc uint64, size uint8, effects []models.Op) blockIns {
+	var regs []RegDelta
 	for _, op := range effects {
 		switch o := op.(type) {
 		case *trace.OpReg:
 			// FIXME: cache reg names as a list
-			name, ok := s.Arch.RegNames()[int(o.Num)]
-			if !ok {
-				name = strconv.Itoa(int(o.Num))
-			}
-			reg := fmt.Sprintf(s.regfmt, name, o.Val)
-			regs = append(regs, reg)
+			name := s.Arch.RegNames()[int(o.Num)]
+			regs = append(regs, RegDelta{Num: int(o.Num), Name: name, Val: o.Val})
 		case *trace.OpSpReg:
-			fmt.Fprintf(s.w, "<unimplemented special register>\n")
+			// No Formatter method carries a special-register delta yet; drop it
+			// rather than writing to s.w directly, which would inject plain text
+			// into JSONFormatter's NDJSON output.
+			_ = o
 		case *trace.OpMemRead:
-			// TODO: hexdump -C
-			mem = append(mem, fmt.Sprintf("R %x", o.Addr))
+			s.memlog.Read(o.Addr, o.Data)
 		case *trace.OpMemWrite:
-			// TODO: hexdump -C
-			mem = append(mem, fmt.Sprintf("W %x", o.Addr))
+			old := make([]byte, len(o.Data))
+			s.Mem.Read(o.Addr, old)
+			s.memlog.Write(o.Addr, o.Data, old)
 		}
 	}
+	return blockIns{pc: pc, size: size, regs: regs}
+}
 
-	var reg, m string
-	if len(regs) > 0 {
-		reg = regs[0] + pad(regs[0], s.regcol)
-	} else {
-		reg = strings.Repeat(" ", s.regcol)
-	}
-	if len(mem) > 0 {
-		m = mem[0]
-	}
-	ins += pad(ins, s.inscol)
-	// TODO: remove dword, etc from x86 disassembly?
-	// generally simplifying disassembly would improve the output
-	// mov eax, dword ptr [eax + 8]
-	// -> mov eax, [eax+8]
-	//
-	// 0x1004: mov eax, 1                   | eax = 1
-	// 0x1008: mov eax, dword ptr [eax + 8] | eax = 2 |R 0x1020 0011 2233 4455 6677 [........]
-	if m == "" {
-		fmt.Fprintf(s.w, "%s | %s\n", ins, reg)
-	} else {
-		fmt.Fprintf(s.w, "%s | %s | %s\n", ins, reg, m)
+// insPrint() decodes a buffered instruction and hands it to the
+// formatter; its memory activity was already folded into the block's
+// MemLog by logEffects and is printed separately by memPrint.
+func (s *StreamUI) insPrint(ins blockIns) {
+	insmem := make([]byte, ins.size)
+	s.Mem.Read(ins.pc, insmem)
+	// TODO: disBytes setting?
+	dis, err := models.Disas(insmem, ins.pc, s.Arch, false)
+	disasm := ""
+	if err == nil {
+		disasm = s.Filters.Apply(ins.pc, dis, s.Arch, s.OS)
 	}
+	s.formatter.Instruction(ins.pc, insmem, disasm, ins.regs)
+}
 
-	// print extra effects
-	if len(regs) > 1 {
-		inspad := strings.Repeat(" ", s.inscol)
-		for i, r := range regs[1:] {
-			if i+1 < len(mem) {
-				fmt.Fprintf(s.w, "%s + %s + %s\n", inspad, r, mem[i+1])
-			} else {
-				fmt.Fprintf(s.w, "%s + %s\n", inspad, r)
+// Interactive runs a small rr/gdb-style reverse-stepi loop on top of an
+// already-fed trace: "n"/"" steps forward, "p" steps back, "g <frame>"
+// seeks directly to a frame, and "q" exits, so execution history can be
+// scrolled through without re-running the emulator. Neither Feed nor Close
+// starts it; it runs only when a caller invokes it on a fed StreamUI.
+func (s *StreamUI) Interactive(in io.Reader) error {
+	scan := bufio.NewScanner(in)
+	for {
+		cur, total := s.player.Frame()
+		fmt.Fprintf(s.w, "(%d/%d) > ", cur, total)
+		if !scan.Scan() {
+			return scan.Err()
+		}
+		fields := strings.Fields(scan.Text())
+		cmd := ""
+		if len(fields) > 0 {
+			cmd = fields[0]
+		}
+		var err error
+		switch cmd {
+		case "", "n":
+			err = s.StepForward()
+		case "p":
+			err = s.StepBack()
+		case "g":
+			if len(fields) != 2 {
+				fmt.Fprintln(s.w, "usage: g <frame>")
+				continue
+			}
+			n, perr := strconv.ParseInt(fields[1], 0, 64)
+			if perr != nil {
+				fmt.Fprintln(s.w, perr)
+				continue
 			}
+			err = s.SeekFrame(n)
+		case "q":
+			return nil
+		default:
+			fmt.Fprintf(s.w, "unknown command %q (try n, p, g <frame>, q)\n", cmd)
+			continue
+		}
+		if err != nil {
+			fmt.Fprintln(s.w, err)
+			continue
 		}
+		fmt.Fprintf(s.w, "%#x\n", s.PC)
 	}
 }
 